@@ -0,0 +1,46 @@
+package flags
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Supported values for a command's -format flag.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// FormatFlag wires up a -format flag shared across operator commands, so
+// the flag name, default, and accepted values are defined once and reused
+// rather than re-implemented per command.
+type FormatFlag struct {
+	format string
+}
+
+// Flags returns a flag.FlagSet containing -format, for merging into a
+// command's own flag set with flags.Merge.
+func (f *FormatFlag) Flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.StringVar(&f.format, "format", FormatText,
+		fmt.Sprintf("Output format. Valid formats are %q and %q.", FormatText, FormatJSON))
+	return fs
+}
+
+// String returns the format requested on the command line.
+func (f *FormatFlag) String() string {
+	if f.format == "" {
+		return FormatText
+	}
+	return f.format
+}
+
+// Validate returns an error if the requested format isn't supported.
+func (f *FormatFlag) Validate() error {
+	switch f.String() {
+	case FormatText, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid format: %s", f.format)
+	}
+}
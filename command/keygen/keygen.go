@@ -0,0 +1,79 @@
+package keygen
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+
+	"github.com/hashicorp/consul/command/flags"
+	"github.com/mitchellh/cli"
+)
+
+func New(ui cli.Ui) *cmd {
+	c := &cmd{UI: ui}
+	c.init()
+	return c
+}
+
+type cmd struct {
+	UI    cli.Ui
+	flags *flag.FlagSet
+	help  string
+
+	// flags
+	keyLength int
+}
+
+func (c *cmd) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.IntVar(&c.keyLength, "key-length", 32,
+		"Length in bytes of the key to generate. Must be 16, 24, or 32, "+
+			"corresponding to AES-128, AES-192, and AES-256 respectively.")
+	c.help = flags.Usage(help, c.flags)
+}
+
+func (c *cmd) Run(args []string) int {
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+
+	switch c.keyLength {
+	case 16, 24, 32:
+	default:
+		c.UI.Error(fmt.Sprintf("Invalid key length %d: must be 16, 24, or 32", c.keyLength))
+		return 1
+	}
+
+	key := make([]byte, c.keyLength)
+	n, err := rand.Reader.Read(key)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading random data: %s", err))
+		return 1
+	}
+	if n != c.keyLength {
+		c.UI.Error("Couldn't read enough entropy. Generate more entropy!")
+		return 1
+	}
+
+	c.UI.Output(base64.StdEncoding.EncodeToString(key))
+	return 0
+}
+
+func (c *cmd) Synopsis() string {
+	return synopsis
+}
+
+func (c *cmd) Help() string {
+	return c.help
+}
+
+const synopsis = "Generates a new encryption key"
+const help = `
+Usage: consul keygen [options]
+
+  Generates a new encryption key that can be used to configure the
+  agent to encrypt network traffic. The output of this command is
+  already in the format expected by the agent and by "consul keyring
+  -install", so it can be used directly without further modification.
+`
@@ -0,0 +1,128 @@
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// jsonKeyStatus is the per-key quorum detail included in -format=json
+// output for -list and -list-primary, so automation doesn't have to
+// parse the "[n/total]" counts out of the text format.
+type jsonKeyStatus struct {
+	Key             string `json:"key"`
+	NumNodesWithKey int    `json:"num_nodes_with_key"`
+	TotalNodes      int    `json:"total_nodes"`
+	FullyPropagated bool   `json:"fully_propagated"`
+}
+
+// jsonPoolResponse is the -format=json representation of a single pool's
+// consulapi.KeyringResponse.
+type jsonPoolResponse struct {
+	Datacenter string            `json:"datacenter"`
+	Segment    string            `json:"segment,omitempty"`
+	WAN        bool              `json:"wan"`
+	Messages   map[string]string `json:"messages,omitempty"`
+	Keys       []jsonKeyStatus   `json:"keys"`
+}
+
+func newJSONPoolResponse(response *consulapi.KeyringResponse, keys map[string]int) jsonPoolResponse {
+	statuses := make([]jsonKeyStatus, 0, len(keys))
+	for key, num := range keys {
+		statuses = append(statuses, jsonKeyStatus{
+			Key:             key,
+			NumNodesWithKey: num,
+			TotalNodes:      response.NumNodes,
+			FullyPropagated: num == response.NumNodes,
+		})
+	}
+
+	return jsonPoolResponse{
+		Datacenter: response.Datacenter,
+		Segment:    response.Segment,
+		WAN:        response.WAN,
+		Messages:   response.Messages,
+		Keys:       statuses,
+	}
+}
+
+// formatResponsesJSON renders the -list/-list-primary responses as a JSON
+// array, one entry per pool.
+func formatResponsesJSON(responses []*consulapi.KeyringResponse, keyFn func(*consulapi.KeyringResponse) map[string]int) (string, error) {
+	pools := make([]jsonPoolResponse, 0, len(responses))
+	for _, response := range responses {
+		pools = append(pools, newJSONPoolResponse(response, keyFn(response)))
+	}
+
+	out, err := json.MarshalIndent(pools, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// jsonActionResult is the -format=json record emitted for a mutating
+// action (install/use/remove), one per pool the follow-up KeyringList
+// reported, mirroring the action taken and whether it fully succeeded in
+// that pool specifically.
+type jsonActionResult struct {
+	Action     string            `json:"action"`
+	Key        string            `json:"key,omitempty"`
+	Datacenter string            `json:"datacenter,omitempty"`
+	WAN        bool              `json:"wan"`
+	Segment    string            `json:"segment,omitempty"`
+	OK         bool              `json:"ok"`
+	Messages   map[string]string `json:"messages,omitempty"`
+}
+
+// actionSucceeded reports whether a single pool's KeyringResponse shows
+// the mutating action fully took effect there: the key installed on (or
+// removed from) every node, or promoted to primary everywhere.
+func actionSucceeded(action, key string, response *consulapi.KeyringResponse) bool {
+	switch action {
+	case "install":
+		return response.Keys[key] == response.NumNodes
+	case "use":
+		return response.PrimaryKeys[key] == response.NumNodes
+	case "remove":
+		_, present := response.Keys[key]
+		return !present
+	default:
+		return false
+	}
+}
+
+// formatActionResultJSON renders the outcome of a mutating action as one
+// record per pool. If actionErr is set, it instead emits a single not-ok
+// record carrying the error; if responses is empty and actionErr is nil,
+// it emits a single ok record with no per-pool detail.
+func formatActionResultJSON(action, key string, responses []*consulapi.KeyringResponse, actionErr error) (string, error) {
+	var results []jsonActionResult
+	if actionErr != nil || len(responses) == 0 {
+		result := jsonActionResult{Action: action, Key: key, OK: actionErr == nil}
+		if actionErr != nil {
+			result.Messages = map[string]string{"error": fmt.Sprintf("%s", actionErr)}
+		}
+		results = []jsonActionResult{result}
+	} else {
+		results = make([]jsonActionResult, 0, len(responses))
+		for _, response := range responses {
+			results = append(results, jsonActionResult{
+				Action:     action,
+				Key:        key,
+				Datacenter: response.Datacenter,
+				WAN:        response.WAN,
+				Segment:    response.Segment,
+				OK:         actionSucceeded(action, key, response),
+				Messages:   response.Messages,
+			})
+		}
+	}
+
+	out, jsonErr := json.MarshalIndent(results, "", "  ")
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	return string(out), nil
+}
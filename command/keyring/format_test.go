@@ -0,0 +1,139 @@
+package keyring
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+func TestActionSucceeded(t *testing.T) {
+	cases := []struct {
+		name     string
+		action   string
+		key      string
+		response *consulapi.KeyringResponse
+		want     bool
+	}{
+		{
+			name:     "install fully propagated",
+			action:   "install",
+			key:      "key-a",
+			response: &consulapi.KeyringResponse{NumNodes: 3, Keys: map[string]int{"key-a": 3}},
+			want:     true,
+		},
+		{
+			name:     "install partially propagated",
+			action:   "install",
+			key:      "key-a",
+			response: &consulapi.KeyringResponse{NumNodes: 3, Keys: map[string]int{"key-a": 2}},
+			want:     false,
+		},
+		{
+			name:     "use fully promoted",
+			action:   "use",
+			key:      "key-a",
+			response: &consulapi.KeyringResponse{NumNodes: 3, PrimaryKeys: map[string]int{"key-a": 3}},
+			want:     true,
+		},
+		{
+			name:     "use partially promoted",
+			action:   "use",
+			key:      "key-a",
+			response: &consulapi.KeyringResponse{NumNodes: 3, PrimaryKeys: map[string]int{"key-a": 1}},
+			want:     false,
+		},
+		{
+			name:     "remove gone everywhere",
+			action:   "remove",
+			key:      "key-a",
+			response: &consulapi.KeyringResponse{NumNodes: 3, Keys: map[string]int{}},
+			want:     true,
+		},
+		{
+			name:     "remove still present somewhere",
+			action:   "remove",
+			key:      "key-a",
+			response: &consulapi.KeyringResponse{NumNodes: 3, Keys: map[string]int{"key-a": 1}},
+			want:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := actionSucceeded(tc.action, tc.key, tc.response); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatActionResultJSON(t *testing.T) {
+	t.Run("one record per pool on success", func(t *testing.T) {
+		responses := []*consulapi.KeyringResponse{
+			{Datacenter: "dc1", Keys: map[string]int{"key-a": 3}, NumNodes: 3},
+			{Datacenter: "dc1", WAN: true, Keys: map[string]int{"key-a": 3}, NumNodes: 3},
+		}
+
+		out, err := formatActionResultJSON("install", "key-a", responses, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var results []jsonActionResult
+		if err := json.Unmarshal([]byte(out), &results); err != nil {
+			t.Fatalf("invalid JSON: %s", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("expected one record per pool, got %d", len(results))
+		}
+		for _, r := range results {
+			if !r.OK {
+				t.Fatalf("expected every pool to report ok, got %+v", r)
+			}
+		}
+	})
+
+	t.Run("action error produces a single failed record", func(t *testing.T) {
+		out, err := formatActionResultJSON("install", "key-a", nil, errors.New("boom"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var results []jsonActionResult
+		if err := json.Unmarshal([]byte(out), &results); err != nil {
+			t.Fatalf("invalid JSON: %s", err)
+		}
+		if len(results) != 1 || results[0].OK {
+			t.Fatalf("expected a single not-ok record, got %+v", results)
+		}
+		if results[0].Messages["error"] == "" {
+			t.Fatalf("expected the error to be surfaced in messages, got %+v", results[0])
+		}
+	})
+}
+
+func TestFormatResponsesJSON(t *testing.T) {
+	responses := []*consulapi.KeyringResponse{
+		{Datacenter: "dc1", NumNodes: 3},
+	}
+
+	out, err := formatResponsesJSON(responses, func(r *consulapi.KeyringResponse) map[string]int {
+		return map[string]int{"key-a": 2}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var pools []jsonPoolResponse
+	if err := json.Unmarshal([]byte(out), &pools); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	if len(pools) != 1 || len(pools[0].Keys) != 1 {
+		t.Fatalf("expected one pool with one key status, got %+v", pools)
+	}
+	if pools[0].Keys[0].FullyPropagated {
+		t.Fatalf("expected key-a not to be reported as fully propagated, got %+v", pools[0].Keys[0])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/consul/agent"
 	consulapi "github.com/hashicorp/consul/api"
@@ -31,6 +32,22 @@ type cmd struct {
 	listPrimaryKeys bool
 	relay           int
 	local           bool
+	lanOnly         bool
+	wanOnly         bool
+
+	rotate  bool
+	newKey  string
+	keep    int
+	timeout time.Duration
+	dryRun  bool
+
+	format flags.FormatFlag
+
+	segments       flags.AppendSliceValue
+	partitionFlags flags.AppendSliceValue
+
+	verify       bool
+	expectedKeys string
 }
 
 func (c *cmd) init() {
@@ -56,9 +73,57 @@ func (c *cmd) init() {
 	c.flags.BoolVar(&c.local, "local-only", false,
 		"Setting this to true will force the keyring query to only hit local servers "+
 			"(no WAN traffic). This flag can only be set for list queries.")
+	c.flags.BoolVar(&c.lanOnly, "lan-only", false,
+		"Setting this to true will restrict -list, -list-primary, or -verify "+
+			"output to the LAN keyring(s) only. The output is filtered after the "+
+			"request; it is not scoped server-side, so this flag is rejected for "+
+			"-install, -use, -remove, and -rotate. Mutually exclusive with -wan-only "+
+			"and -local-only.")
+	c.flags.BoolVar(&c.wanOnly, "wan-only", false,
+		"Setting this to true will restrict -list, -list-primary, or -verify "+
+			"output to the WAN keyring only. The output is filtered after the "+
+			"request; it is not scoped server-side, so this flag is rejected for "+
+			"-install, -use, -remove, and -rotate. Mutually exclusive with -lan-only "+
+			"and -local-only.")
+	c.flags.BoolVar(&c.rotate, "rotate", false,
+		"Perform a full cluster-wide key rotation: install a new key, verify "+
+			"every node has it, promote it to primary, and remove retired keys. "+
+			"Replaces the install/use/remove runbook with a single operation.")
+	c.flags.StringVar(&c.newKey, "new-key", "",
+		"The key to install and promote when used with -rotate. If omitted, a "+
+			"new key is generated the same way 'consul keygen' would.")
+	c.flags.IntVar(&c.keep, "keep", 1,
+		"When used with -rotate, the number of other installed keys to leave "+
+			"in place instead of removing. The server does not track promotion "+
+			"order, so which keys are kept is deterministic but arbitrary; pass "+
+			"-keep 0 to remove every key except the new one, or inspect "+
+			"-dry-run output and remove specific keys by hand for precise control.")
+	c.flags.DurationVar(&c.timeout, "timeout", 1*time.Minute,
+		"When used with -rotate, the maximum time to allow the rotation to run "+
+			"before aborting without removing any remaining retired keys.")
+	c.flags.BoolVar(&c.dryRun, "dry-run", false,
+		"When used with -rotate, print the rotation plan without installing, "+
+			"promoting, or removing any keys.")
+
+	c.flags.Var(&c.segments, "segment",
+		"Filter -list, -list-primary, or -verify output down to a specific "+
+			"network segment. May be given multiple times. The keyring RPCs "+
+			"have no field to scope a request to specific segments server-side, "+
+			"so this flag is rejected for -install, -use, -remove, and -rotate.")
+	c.initEnterpriseFlags()
+
+	c.flags.BoolVar(&c.verify, "verify", false,
+		"Report keyring drift across the cluster: keys missing from some "+
+			"nodes, keys installed that shouldn't be, and nodes whose primary "+
+			"key disagrees with the rest of the pool. Exits non-zero if drift "+
+			"or unreachable nodes are found.")
+	c.flags.StringVar(&c.expectedKeys, "expected-keys", "",
+		"Comma-separated list of keys the keyring is expected to contain. "+
+			"Used with -verify instead of comparing against the pool's majority.")
 
 	c.http = &flags.HTTPFlags{}
 	flags.Merge(c.flags, c.http.ClientFlags())
+	flags.Merge(c.flags, c.format.Flags())
 	c.help = flags.Usage(help, c.flags)
 }
 
@@ -75,7 +140,14 @@ func (c *cmd) Run(args []string) int {
 	}
 
 	// Only accept a single argument
-	found := c.listKeys || c.listPrimaryKeys
+	found := false
+	for _, set := range []bool{c.listKeys, c.listPrimaryKeys, c.rotate, c.verify} {
+		if found && set {
+			c.UI.Error("Only a single action is allowed")
+			return 1
+		}
+		found = found || set
+	}
 	for _, arg := range []string{c.installKey, c.useKey, c.removeKey} {
 		if found && len(arg) > 0 {
 			c.UI.Error("Only a single action is allowed")
@@ -104,6 +176,52 @@ func (c *cmd) Run(args []string) int {
 		return 1
 	}
 
+	// Validate the pool scope
+	if c.lanOnly && c.wanOnly {
+		c.UI.Error("Only one of -lan-only or -wan-only may be given")
+		return 1
+	}
+	if (c.lanOnly || c.wanOnly) && c.local {
+		c.UI.Error("-local-only cannot be combined with -lan-only or -wan-only")
+		return 1
+	}
+	// -lan-only/-wan-only are implemented as a client-side filter on
+	// -list/-list-primary/-verify output. There is no server-side request
+	// field to scope install/use/remove/-rotate to a single pool, and
+	// silently running them against both pools anyway would defeat the
+	// point of the flag, so refuse instead.
+	if (c.lanOnly || c.wanOnly) && (c.installKey != "" || c.useKey != "" || c.removeKey != "" || c.rotate) {
+		c.UI.Error("-lan-only and -wan-only are only supported for -list, -list-primary, and -verify; " +
+			"the keyring RPCs do not yet support scoping a mutation to a single pool")
+		return 1
+	}
+
+	// -segment is the same story as -lan-only/-wan-only: there is no field
+	// on consulapi.WriteOptions/QueryOptions to scope a keyring RPC to
+	// specific segments, only response data to filter after the fact, so
+	// mutations that asked for it are refused rather than silently
+	// broadcast to every segment anyway.
+	if len(c.segments) > 0 && (c.installKey != "" || c.useKey != "" || c.removeKey != "" || c.rotate) {
+		c.UI.Error("-segment is only supported for -list, -list-primary, and -verify; " +
+			"the keyring RPCs do not yet support scoping a mutation to specific segments")
+		return 1
+	}
+
+	// -partition can't even be offered as a read-side filter today:
+	// consulapi.KeyringResponse carries a Segment but no Partition field,
+	// so there is nothing to scope by or filter on for any action.
+	if c.enterprisePartitionsRequested() {
+		c.UI.Error("-partition is not yet supported: the keyring RPCs do not expose " +
+			"a partition field to scope a request or filter a response by")
+		return 1
+	}
+
+	// Validate the output format
+	if err := c.format.Validate(); err != nil {
+		c.UI.Error(fmt.Sprintf("Error validating format: %s", err))
+		return 1
+	}
+
 	// All other operations will require a client connection
 	client, err := c.http.APIClient()
 	if err != nil {
@@ -111,67 +229,239 @@ func (c *cmd) Run(args []string) int {
 		return 1
 	}
 
+	scope := c.scope()
+	segments := []string(c.segments)
+
 	if c.listKeys {
-		c.UI.Info("Gathering installed encryption keys...")
-		responses, err := client.Operator().KeyringList(&consulapi.QueryOptions{RelayFactor: relayFactor, LocalOnly: c.local})
+		if c.format.String() != flags.FormatJSON {
+			c.UI.Info("Gathering installed encryption keys...")
+		}
+		queryOpts := &consulapi.QueryOptions{RelayFactor: relayFactor, LocalOnly: c.local}
+		responses, err := client.Operator().KeyringList(queryOpts)
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("error: %s", err))
 			return 1
 		}
-		for _, response := range responses {
-			c.UI.Output(formatResponse(response, response.Keys))
-		}
-		return 0
+		responses = filterBySegments(filterByScope(responses, scope), segments)
+		return c.outputKeyringList(responses, func(r *consulapi.KeyringResponse) map[string]int { return r.Keys })
 	}
 
 	if c.listPrimaryKeys {
-		c.UI.Info("Gathering installed primary encryption keys...")
-		responses, err := client.Operator().KeyringList(&consulapi.QueryOptions{RelayFactor: relayFactor, LocalOnly: c.local})
+		if c.format.String() != flags.FormatJSON {
+			c.UI.Info("Gathering installed primary encryption keys...")
+		}
+		queryOpts := &consulapi.QueryOptions{RelayFactor: relayFactor, LocalOnly: c.local}
+		responses, err := client.Operator().KeyringList(queryOpts)
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("error: %s", err))
 			return 1
 		}
-		for _, response := range responses {
-			c.UI.Output(formatResponse(response, response.PrimaryKeys))
-		}
-		return 0
+		responses = filterBySegments(filterByScope(responses, scope), segments)
+		return c.outputKeyringList(responses, func(r *consulapi.KeyringResponse) map[string]int { return r.PrimaryKeys })
+	}
+
+	if c.verify {
+		queryOpts := &consulapi.QueryOptions{RelayFactor: relayFactor, LocalOnly: c.local}
+		return c.verifyKeyring(client, queryOpts)
 	}
 
 	opts := &consulapi.WriteOptions{RelayFactor: relayFactor}
+	queryOpts := &consulapi.QueryOptions{RelayFactor: relayFactor, LocalOnly: c.local}
+
+	if c.rotate {
+		return c.rotateKeyring(client, opts, queryOpts)
+	}
+
 	if c.installKey != "" {
-		c.UI.Info("Installing new gossip encryption key...")
+		if c.format.String() != flags.FormatJSON {
+			c.UI.Info("Installing new gossip encryption key...")
+		}
 		err := client.Operator().KeyringInstall(c.installKey, opts)
+		return c.outputActionResult(client, queryOpts, "install", c.installKey, err)
+	}
+
+	if c.useKey != "" {
+		if c.format.String() != flags.FormatJSON {
+			c.UI.Info("Changing primary gossip encryption key...")
+		}
+		err := client.Operator().KeyringUse(c.useKey, opts)
+		return c.outputActionResult(client, queryOpts, "use", c.useKey, err)
+	}
+
+	if c.removeKey != "" {
+		if c.format.String() != flags.FormatJSON {
+			c.UI.Info("Removing gossip encryption key...")
+		}
+		err := client.Operator().KeyringRemove(c.removeKey, opts)
+		return c.outputActionResult(client, queryOpts, "remove", c.removeKey, err)
+	}
+
+	// Should never make it here
+	return 0
+}
+
+// outputKeyringList prints the responses from a -list or -list-primary
+// query in the requested format.
+func (c *cmd) outputKeyringList(responses []*consulapi.KeyringResponse, keyFn func(*consulapi.KeyringResponse) map[string]int) int {
+	if c.format.String() == flags.FormatJSON {
+		out, err := formatResponsesJSON(responses, keyFn)
 		if err != nil {
-			c.UI.Error(fmt.Sprintf("error: %s", err))
+			c.UI.Error(fmt.Sprintf("error formatting output: %s", err))
 			return 1
 		}
+		c.UI.Output(out)
 		return 0
 	}
 
-	if c.useKey != "" {
-		c.UI.Info("Changing primary gossip encryption key...")
-		err := client.Operator().KeyringUse(c.useKey, opts)
+	for _, response := range responses {
+		c.UI.Output(formatResponse(response, keyFn(response)))
+	}
+	return 0
+}
+
+// outputActionResult prints the outcome of a mutating action (install, use,
+// or remove) in the requested format, returning the exit code for Run. In
+// JSON format it follows up with a KeyringList so it can report one record
+// per pool touched, since KeyringInstall/Use/Remove themselves return only
+// a single aggregate error with no per-pool detail.
+func (c *cmd) outputActionResult(client *consulapi.Client, queryOpts *consulapi.QueryOptions, action, key string, actionErr error) int {
+	if c.format.String() == flags.FormatJSON {
+		var responses []*consulapi.KeyringResponse
+		reportErr := actionErr
+		if actionErr == nil {
+			listResponses, err := client.Operator().KeyringList(queryOpts)
+			if err != nil {
+				// The mutation itself reported success, but we can't confirm
+				// what it actually did without this list. Surface that as a
+				// failure rather than defaulting to OK: true with no detail.
+				reportErr = fmt.Errorf("action succeeded but fetching the resulting keyring state failed: %s", err)
+			} else {
+				responses = listResponses
+			}
+		}
+
+		out, err := formatActionResultJSON(action, key, responses, reportErr)
 		if err != nil {
-			c.UI.Error(fmt.Sprintf("error: %s", err))
+			c.UI.Error(fmt.Sprintf("error formatting output: %s", err))
+			return 1
+		}
+		c.UI.Output(out)
+
+		if reportErr != nil {
 			return 1
 		}
+		for _, response := range responses {
+			if !actionSucceeded(action, key, response) {
+				return 1
+			}
+		}
 		return 0
 	}
 
-	if c.removeKey != "" {
-		c.UI.Info("Removing gossip encryption key...")
-		err := client.Operator().KeyringRemove(c.removeKey, opts)
+	if actionErr != nil {
+		c.UI.Error(fmt.Sprintf("error: %s", actionErr))
+		return 1
+	}
+	return 0
+}
+
+// rotateKeyring drives a full install/verify/promote/remove cycle through
+// the rotator state machine, reporting the plan either way and only
+// mutating the cluster when -dry-run is not set.
+func (c *cmd) rotateKeyring(client *consulapi.Client, opts *consulapi.WriteOptions, queryOpts *consulapi.QueryOptions) int {
+	newKey := c.newKey
+	if newKey == "" {
+		key, err := generateKey()
 		if err != nil {
-			c.UI.Error(fmt.Sprintf("error: %s", err))
+			c.UI.Error(fmt.Sprintf("Error generating new key: %s", err))
 			return 1
 		}
+		newKey = key
+	}
+
+	r := newRotator(client, c.UI, opts, queryOpts, c.timeout)
+	plan, err := r.plan(newKey, c.keep)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("error: %s", err))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("New key to install and promote: %s", plan.NewKey))
+	if len(plan.RetiredKeys) == 0 {
+		c.UI.Info("No keys will be removed")
+	} else {
+		c.UI.Info("Keys to be removed once the new key is primary:")
+		for _, key := range plan.RetiredKeys {
+			c.UI.Info(fmt.Sprintf("  %s", key))
+		}
+	}
+
+	if c.dryRun {
 		return 0
 	}
 
-	// Should never make it here
+	if err := r.run(plan); err != nil {
+		c.UI.Error(fmt.Sprintf("error: %s", err))
+		return 1
+	}
+
+	c.UI.Info("Key rotation complete")
 	return 0
 }
 
+// verifyKeyring gathers the current keyring state and reports any drift: keys
+// missing from some nodes, keys present that shouldn't be, and pools whose
+// primary key disagrees. It returns ExitNodesUnreachable if any node failed
+// to reply, ExitDriftDetected if the cluster replied fully but disagrees,
+// or 0 if the keyring is consistent everywhere.
+func (c *cmd) verifyKeyring(client *consulapi.Client, queryOpts *consulapi.QueryOptions) int {
+	var expectedKeys []string
+	if c.expectedKeys != "" {
+		expectedKeys = strings.Split(c.expectedKeys, ",")
+	}
+
+	responses, err := client.Operator().KeyringList(queryOpts)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("error: %s", err))
+		return 1
+	}
+	responses = filterBySegments(filterByScope(responses, c.scope()), []string(c.segments))
+
+	drifts := make([]poolDrift, 0, len(responses))
+	unreachable := false
+	driftDetected := false
+	for _, response := range responses {
+		drift := computePoolDrift(response, expectedKeys)
+		drifts = append(drifts, drift)
+		if len(drift.Unreachable) > 0 {
+			unreachable = true
+		}
+		if drift.hasDrift() {
+			driftDetected = true
+		}
+	}
+
+	if c.format.String() == flags.FormatJSON {
+		out, err := formatDriftJSON(drifts)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("error formatting output: %s", err))
+			return 1
+		}
+		c.UI.Output(out)
+	} else {
+		c.UI.Output(formatDrift(drifts))
+	}
+
+	switch {
+	case unreachable:
+		return ExitNodesUnreachable
+	case driftDetected:
+		return ExitDriftDetected
+	default:
+		return 0
+	}
+}
+
 func formatResponse(response *consulapi.KeyringResponse, keys map[string]int) string {
 	result := []string{
 		"",
@@ -182,6 +472,79 @@ func formatResponse(response *consulapi.KeyringResponse, keys map[string]int) st
 	return strings.Replace(strings.Join(result, "\n"), "\n\n", "\n", -1)
 }
 
+// poolScope is purely a client-side concept: there is no field on
+// consulapi.WriteOptions/QueryOptions to ask the server to scope a keyring
+// RPC to one pool, so -lan-only/-wan-only can only ever filter the
+// responses a broadcast-to-all request already returns.
+type poolScope string
+
+const (
+	poolScopeLAN poolScope = "lan"
+	poolScopeWAN poolScope = "wan"
+)
+
+// scope translates the -lan-only/-wan-only flags into a poolScope for
+// filtering response output. An empty scope means "both", preserving
+// today's behavior.
+func (c *cmd) scope() poolScope {
+	switch {
+	case c.lanOnly:
+		return poolScopeLAN
+	case c.wanOnly:
+		return poolScopeWAN
+	default:
+		return ""
+	}
+}
+
+// filterByScope drops responses that don't match the requested scope. This
+// is the only enforcement -lan-only/-wan-only get: it filters what's
+// printed for -list/-list-primary/-verify, it does not (and cannot, without
+// server-side support) stop a mutation from reaching the other pool, which
+// is why Run refuses -lan-only/-wan-only for install/use/remove/-rotate.
+func filterByScope(responses []*consulapi.KeyringResponse, scope poolScope) []*consulapi.KeyringResponse {
+	if scope == "" {
+		return responses
+	}
+
+	filtered := make([]*consulapi.KeyringResponse, 0, len(responses))
+	for _, response := range responses {
+		if scope == poolScopeWAN && !response.WAN {
+			continue
+		}
+		if scope == poolScopeLAN && response.WAN {
+			continue
+		}
+		filtered = append(filtered, response)
+	}
+	return filtered
+}
+
+// filterBySegments drops responses whose segment isn't one of the
+// requested -segment values. Like filterByScope, this only filters the
+// responses a broadcast-to-every-segment request already returned; there
+// is no field on consulapi.WriteOptions/QueryOptions to ask the server to
+// scope a keyring RPC to specific segments, which is why Run refuses
+// -segment for install/use/remove/-rotate.
+func filterBySegments(responses []*consulapi.KeyringResponse, segments []string) []*consulapi.KeyringResponse {
+	if len(segments) == 0 {
+		return responses
+	}
+
+	want := make(map[string]bool, len(segments))
+	for _, segment := range segments {
+		want[segment] = true
+	}
+
+	filtered := make([]*consulapi.KeyringResponse, 0, len(responses))
+	for _, response := range responses {
+		if want[response.Segment] {
+			filtered = append(filtered, response)
+		}
+	}
+	return filtered
+}
+
 func poolName(dc string, wan bool, segment string) string {
 	pool := fmt.Sprintf("%s (LAN)", dc)
 	if wan {
@@ -230,6 +593,39 @@ Usage: consul keyring [options]
   All operations performed by this command can only be run against server nodes,
   and affect both the LAN and WAN keyrings in lock-step.
 
+  The -rotate flag automates the install/use/remove sequence documented for
+  manual key rotation: it installs a new key (generating one if -new-key is
+  not given), verifies every node has it, promotes it to primary, and then
+  removes other installed keys beyond the -keep kept arbitrarily (the server
+  does not track promotion order, so retention is deterministic but not
+  based on recency). Pass -dry-run to print the plan without changing
+  anything, and the rotation aborts without removing further keys if
+  -timeout elapses.
+
+  Pass -lan-only or -wan-only to restrict -list, -list-primary, or -verify
+  to a single pool's output, and -segment to further restrict it to one or
+  more network segments. There is currently no way to scope a mutation
+  (-install, -use, -remove, -rotate) to a single pool or segment
+  server-side, so these flags are rejected for those actions rather than
+  silently running them against every pool and segment anyway.
+
+  -partition is not yet supported on any action: the keyring RPCs expose
+  no partition field to scope a request or filter a response by, so
+  Consul Enterprise builds reject it rather than silently ignoring it.
+
+  Pass -format=json to -list, -list-primary, -install, -use, -remove, or
+  -verify to get machine-readable output instead of the default
+  human-readable text, suitable for monitoring and automation.
+
+  The -verify flag checks the cluster for keyring drift instead of mutating
+  anything: keys missing from some nodes, keys installed that shouldn't be,
+  and pools whose primary key disagrees. By default drift is measured
+  against each pool's own majority; pass -expected-keys to compare against
+  an intended keyring instead. -verify exits 2 if drift is found and 3 if
+  any node was unreachable, in place of the exit code 1 described below, so
+  it can be run from cron or CI to catch a partial rotation before it
+  causes gossip decryption failures.
+
   All variations of the keyring command return 0 if all nodes reply and there
   are no errors. If any node fails to reply or reports failure, the exit code
   will be 1.
@@ -0,0 +1,21 @@
+//go:build consulent
+// +build consulent
+
+package keyring
+
+// initEnterpriseFlags registers the -partition flag, which only applies to
+// Consul Enterprise's admin partitions. The keyring RPCs have no partition
+// field to scope or filter a request by, so for now this flag is accepted
+// only to produce a clear rejection in Run rather than a "flag not
+// recognized" error on Enterprise builds.
+func (c *cmd) initEnterpriseFlags() {
+	c.flags.Var(&c.partitionFlags, "partition",
+		"Target this operation at a specific admin partition. Requires Consul "+
+			"Enterprise. Not yet implemented: the keyring RPCs have no partition "+
+			"field to scope or filter by, so this flag is currently rejected.")
+}
+
+// enterprisePartitionsRequested reports whether -partition was given.
+func (c *cmd) enterprisePartitionsRequested() bool {
+	return len(c.partitionFlags) > 0
+}
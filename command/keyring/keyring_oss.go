@@ -0,0 +1,12 @@
+//go:build !consulent
+// +build !consulent
+
+package keyring
+
+// initEnterpriseFlags is a no-op in the open-source build; the -partition
+// flag is only registered in the Consul Enterprise build.
+func (c *cmd) initEnterpriseFlags() {}
+
+// enterprisePartitionsRequested always reports false in the open-source
+// build, since -partition isn't registered and so can never be set.
+func (c *cmd) enterprisePartitionsRequested() bool { return false }
@@ -0,0 +1,92 @@
+package keyring
+
+import (
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+func TestFilterByScope(t *testing.T) {
+	responses := []*consulapi.KeyringResponse{
+		{Datacenter: "dc1"},
+		{Datacenter: "dc1", WAN: true},
+	}
+
+	cases := []struct {
+		name      string
+		scope     poolScope
+		wantCount int
+		wantWAN   bool
+	}{
+		{"no scope returns everything", "", 2, false},
+		{"lan scope keeps only non-WAN", poolScopeLAN, 1, false},
+		{"wan scope keeps only WAN", poolScopeWAN, 1, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := filterByScope(responses, tc.scope)
+			if len(got) != tc.wantCount {
+				t.Fatalf("got %d responses, want %d", len(got), tc.wantCount)
+			}
+			if tc.scope != "" && got[0].WAN != tc.wantWAN {
+				t.Fatalf("got WAN=%v, want %v", got[0].WAN, tc.wantWAN)
+			}
+		})
+	}
+}
+
+func TestFilterBySegments(t *testing.T) {
+	responses := []*consulapi.KeyringResponse{
+		{Datacenter: "dc1", Segment: ""},
+		{Datacenter: "dc1", Segment: "seg-a"},
+		{Datacenter: "dc1", Segment: "seg-b"},
+	}
+
+	cases := []struct {
+		name     string
+		segments []string
+		want     []string
+	}{
+		{"no segments returns everything", nil, []string{"", "seg-a", "seg-b"}},
+		{"single segment filters down", []string{"seg-a"}, []string{"seg-a"}},
+		{"multiple segments keep each match", []string{"seg-a", "seg-b"}, []string{"seg-a", "seg-b"}},
+		{"unmatched segment filters out everything", []string{"seg-missing"}, []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := filterBySegments(responses, tc.segments)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d responses, want %d", len(got), len(tc.want))
+			}
+			for i, response := range got {
+				if response.Segment != tc.want[i] {
+					t.Fatalf("got segment %q at index %d, want %q", response.Segment, i, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCmdScope(t *testing.T) {
+	cases := []struct {
+		name    string
+		lanOnly bool
+		wanOnly bool
+		want    poolScope
+	}{
+		{"neither set", false, false, ""},
+		{"lan only", true, false, poolScopeLAN},
+		{"wan only", false, true, poolScopeWAN},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &cmd{lanOnly: tc.lanOnly, wanOnly: tc.wanOnly}
+			if got := c.scope(); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// rotationStep identifies a single phase of a key rotation.
+type rotationStep string
+
+const (
+	stepInstall rotationStep = "install"
+	stepUse     rotationStep = "use"
+	stepRemove  rotationStep = "remove"
+)
+
+// rotationPlan describes the work a -rotate invocation intends to perform.
+// It is computed up front so that -dry-run can print it without touching
+// the cluster, and so the live run can execute exactly what was printed.
+type rotationPlan struct {
+	NewKey      string
+	RetiredKeys []string
+}
+
+// rotator drives the install -> use -> remove sequence that today's
+// operators perform by hand with three separate `consul keyring`
+// invocations. The install phase is checked against every pool's
+// KeyringList response before the key is promoted, and an error from any
+// phase's RPC stops the rotation before the next phase begins.
+type rotator struct {
+	client  *consulapi.Client
+	ui      outputter
+	opts    *consulapi.WriteOptions
+	query   *consulapi.QueryOptions
+	timeout time.Duration
+}
+
+// outputter is the subset of cli.Ui that rotate needs; it's a separate
+// interface so tests can supply a stub instead of a full cli.Ui.
+type outputter interface {
+	Info(string)
+	Output(string)
+	Error(string)
+}
+
+func newRotator(client *consulapi.Client, ui outputter, opts *consulapi.WriteOptions, query *consulapi.QueryOptions, timeout time.Duration) *rotator {
+	return &rotator{client: client, ui: ui, opts: opts, query: query, timeout: timeout}
+}
+
+// generateKey produces a fresh 32-byte gossip key in the same format
+// KeyringInstall expects, mirroring `consul keygen`.
+func generateKey() (string, error) {
+	key := make([]byte, 32)
+	n, err := rand.Reader.Read(key)
+	if err != nil {
+		return "", fmt.Errorf("error reading random data: %s", err)
+	}
+	if n != 32 {
+		return "", fmt.Errorf("couldn't read enough entropy. Generate more entropy!")
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// plan figures out what a rotation will do without mutating anything: the
+// key to install and the set of other installed keys that are eligible to
+// be retired once the new key is promoted, after keeping `keep` of them.
+func (r *rotator) plan(newKey string, keep int) (*rotationPlan, error) {
+	responses, err := r.client.Operator().KeyringList(r.query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing existing keys: %s", err)
+	}
+
+	retired := computeRetiredKeys(responses, newKey, keep)
+	return &rotationPlan{NewKey: newKey, RetiredKeys: retired}, nil
+}
+
+// computeRetiredKeys returns the keys currently installed somewhere in the
+// cluster, across all reported pools, other than the new key being
+// installed and the `keep` keys this call chooses to leave alone.
+//
+// The server has no notion of when a key was promoted, so there is no real
+// signal to rank these by "most recently retired". Rather than depend on
+// Go's randomized map iteration order (which would make -keep nondeterministic
+// and could retire the wrong key from one run to the next), candidates are
+// sorted alphabetically and the first `keep` of them are kept, for a
+// stable, reproducible result. Operators who need precise retention can
+// inspect the -dry-run plan and remove specific keys by hand with -remove.
+func computeRetiredKeys(responses []*consulapi.KeyringResponse, newKey string, keep int) []string {
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, response := range responses {
+		for key := range response.Keys {
+			if key == newKey || seen[key] {
+				continue
+			}
+			seen[key] = true
+			candidates = append(candidates, key)
+		}
+	}
+	sort.Strings(candidates)
+
+	if keep < 0 {
+		keep = 0
+	}
+	if keep >= len(candidates) {
+		return nil
+	}
+	return candidates[keep:]
+}
+
+// run executes the rotation: install, verify, promote, then remove every
+// retired key. Any failed phase aborts the rotation immediately so the
+// operator is never left with a half-rotated cluster.
+func (r *rotator) run(plan *rotationPlan) error {
+	deadline := time.Now().Add(r.timeout)
+
+	r.ui.Info("Installing new gossip encryption key...")
+	if err := r.client.Operator().KeyringInstall(plan.NewKey, r.opts); err != nil {
+		return fmt.Errorf("error installing new key: %s", err)
+	}
+	if time.Now().After(deadline) {
+		return fmt.Errorf("timed out waiting for key installation to be verified")
+	}
+	if err := r.verifyInstalled(plan.NewKey); err != nil {
+		return err
+	}
+
+	r.ui.Info("Promoting new gossip encryption key to primary...")
+	if err := r.client.Operator().KeyringUse(plan.NewKey, r.opts); err != nil {
+		return fmt.Errorf("error promoting new key: %s", err)
+	}
+
+	for _, key := range plan.RetiredKeys {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out before removing all retired keys, %s and later were left installed", key)
+		}
+		r.ui.Info(fmt.Sprintf("Removing retired gossip encryption key %s...", key))
+		if err := r.client.Operator().KeyringRemove(key, r.opts); err != nil {
+			return fmt.Errorf("error removing retired key: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// verifyInstalled confirms every node in every pool reported the new key as
+// installed before we move on to promoting it. A key present on only some
+// nodes is not enough: promoting it to primary at that point would leave
+// the remaining nodes unable to decrypt gossip from the rest of the cluster.
+func (r *rotator) verifyInstalled(key string) error {
+	responses, err := r.client.Operator().KeyringList(r.query)
+	if err != nil {
+		return fmt.Errorf("error verifying key installation: %s", err)
+	}
+	for _, response := range responses {
+		if response.Keys[key] != response.NumNodes {
+			return fmt.Errorf("key not yet installed on every node in pool %s (%d/%d)",
+				poolName(response.Datacenter, response.WAN, response.Segment), response.Keys[key], response.NumNodes)
+		}
+	}
+	return nil
+}
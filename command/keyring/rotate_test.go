@@ -0,0 +1,43 @@
+package keyring
+
+import (
+	"reflect"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+func TestComputeRetiredKeys(t *testing.T) {
+	responses := []*consulapi.KeyringResponse{
+		{
+			Datacenter: "dc1",
+			Keys:       map[string]int{"key-a": 3, "key-b": 3},
+		},
+		{
+			Datacenter: "dc1",
+			WAN:        true,
+			Keys:       map[string]int{"key-a": 3, "key-c": 3},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		newKey  string
+		keep    int
+		wantOut []string
+	}{
+		{"keep none", "key-new", 0, []string{"key-a", "key-b", "key-c"}},
+		{"keep one", "key-new", 1, []string{"key-b", "key-c"}},
+		{"keep more than available", "key-new", 10, nil},
+		{"new key already listed is excluded", "key-a", 0, []string{"key-b", "key-c"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := computeRetiredKeys(responses, tc.newKey, tc.keep)
+			if !reflect.DeepEqual(got, tc.wantOut) {
+				t.Fatalf("got %v, want %v", got, tc.wantOut)
+			}
+		})
+	}
+}
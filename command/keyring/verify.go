@@ -0,0 +1,158 @@
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// Exit codes returned by -verify. These are distinct from the generic 1
+// used elsewhere in this command so cron/CI can tell a cluster that's
+// reachable but drifted apart from one that couldn't be fully queried.
+const (
+	ExitDriftDetected    = 2
+	ExitNodesUnreachable = 3
+)
+
+// poolDrift summarizes the keyring drift detected within a single pool.
+// consulapi.KeyringResponse only reports per-key node counts rather than
+// which specific node holds which key, so missing/extra are counts and
+// name sets rather than a true node-by-node breakdown; the nodes that
+// failed to reply at all are the one thing we can name individually, via
+// response.Messages.
+type poolDrift struct {
+	Pool                string
+	MissingKeys         map[string]int // installed key -> number of nodes missing it
+	ExtraKeys           []string       // installed keys not in the expected/majority set
+	PrimaryDisagreement map[string]int // candidate primary key -> number of nodes reporting it
+	Unreachable         []string       // nodes that returned an error for this pool
+}
+
+func (d poolDrift) hasDrift() bool {
+	return len(d.MissingKeys) > 0 || len(d.ExtraKeys) > 0 || len(d.PrimaryDisagreement) > 1
+}
+
+// computePoolDrift compares a single pool's KeyringList response against
+// either an operator-supplied expected keyring or, if none was given, the
+// pool's own majority.
+func computePoolDrift(response *consulapi.KeyringResponse, expectedKeys []string) poolDrift {
+	drift := poolDrift{
+		Pool:                poolName(response.Datacenter, response.WAN, response.Segment),
+		MissingKeys:         map[string]int{},
+		PrimaryDisagreement: map[string]int{},
+	}
+
+	expected := make(map[string]bool, len(expectedKeys))
+	for _, key := range expectedKeys {
+		expected[key] = true
+	}
+
+	for key, count := range response.Keys {
+		if count < response.NumNodes {
+			drift.MissingKeys[key] = response.NumNodes - count
+		}
+
+		switch {
+		case len(expected) > 0 && !expected[key]:
+			drift.ExtraKeys = append(drift.ExtraKeys, key)
+		case len(expected) == 0 && count*2 < response.NumNodes:
+			// No expected keyring was given, so fall back to majority: a
+			// key installed on fewer than half the nodes is an outlier.
+			drift.ExtraKeys = append(drift.ExtraKeys, key)
+		}
+	}
+	sort.Strings(drift.ExtraKeys)
+
+	// A key that's expected but absent from response.Keys entirely never
+	// goes through the loop above, since it has no entry to range over.
+	// That's the worst case of drift - every node is missing it - so it
+	// needs to be flagged here instead of silently passing as "ok".
+	for key := range expected {
+		if _, ok := response.Keys[key]; !ok {
+			drift.MissingKeys[key] = response.NumNodes
+		}
+	}
+
+	if len(response.PrimaryKeys) > 1 {
+		for key, count := range response.PrimaryKeys {
+			drift.PrimaryDisagreement[key] = count
+		}
+	}
+
+	for node := range response.Messages {
+		drift.Unreachable = append(drift.Unreachable, node)
+	}
+	sort.Strings(drift.Unreachable)
+
+	return drift
+}
+
+// formatDrift renders the per-pool drift report as human-readable text.
+func formatDrift(drifts []poolDrift) string {
+	var b strings.Builder
+	for _, d := range drifts {
+		fmt.Fprintf(&b, "\n%s:\n", d.Pool)
+		if len(d.Unreachable) > 0 {
+			fmt.Fprintf(&b, "  unreachable: %s\n", strings.Join(d.Unreachable, ", "))
+		}
+		if !d.hasDrift() {
+			b.WriteString("  ok\n")
+			continue
+		}
+		for _, key := range sortedKeys(d.MissingKeys) {
+			fmt.Fprintf(&b, "  missing: %s [%d node(s) do not have this key]\n", key, d.MissingKeys[key])
+		}
+		for _, key := range d.ExtraKeys {
+			fmt.Fprintf(&b, "  extra:   %s [not in expected/majority keyring]\n", key)
+		}
+		if len(d.PrimaryDisagreement) > 1 {
+			b.WriteString("  primary: disagreement across candidate keys:\n")
+			for _, key := range sortedKeys(d.PrimaryDisagreement) {
+				fmt.Fprintf(&b, "             %s [%d node(s)]\n", key, d.PrimaryDisagreement[key])
+			}
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonPoolDrift is the -format=json representation of poolDrift.
+type jsonPoolDrift struct {
+	Pool                string         `json:"pool"`
+	Missing             map[string]int `json:"missing,omitempty"`
+	Extra               []string       `json:"extra,omitempty"`
+	PrimaryDisagreement map[string]int `json:"primary_disagreement,omitempty"`
+	Unreachable         []string       `json:"unreachable,omitempty"`
+	OK                  bool           `json:"ok"`
+}
+
+func formatDriftJSON(drifts []poolDrift) (string, error) {
+	out := make([]jsonPoolDrift, 0, len(drifts))
+	for _, d := range drifts {
+		out = append(out, jsonPoolDrift{
+			Pool:                d.Pool,
+			Missing:             d.MissingKeys,
+			Extra:               d.ExtraKeys,
+			PrimaryDisagreement: d.PrimaryDisagreement,
+			Unreachable:         d.Unreachable,
+			OK:                  !d.hasDrift() && len(d.Unreachable) == 0,
+		})
+	}
+
+	bytes, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
@@ -0,0 +1,100 @@
+package keyring
+
+import (
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+func TestComputePoolDrift(t *testing.T) {
+	t.Run("fully propagated is not drift", func(t *testing.T) {
+		response := &consulapi.KeyringResponse{
+			Datacenter:  "dc1",
+			NumNodes:    3,
+			Keys:        map[string]int{"key-a": 3},
+			PrimaryKeys: map[string]int{"key-a": 3},
+		}
+
+		drift := computePoolDrift(response, nil)
+		if drift.hasDrift() {
+			t.Fatalf("expected no drift, got %+v", drift)
+		}
+	})
+
+	t.Run("missing key on some nodes", func(t *testing.T) {
+		response := &consulapi.KeyringResponse{
+			Datacenter:  "dc1",
+			NumNodes:    3,
+			Keys:        map[string]int{"key-a": 2},
+			PrimaryKeys: map[string]int{"key-a": 2},
+		}
+
+		drift := computePoolDrift(response, nil)
+		if !drift.hasDrift() {
+			t.Fatalf("expected drift")
+		}
+		if drift.MissingKeys["key-a"] != 1 {
+			t.Fatalf("expected 1 node missing key-a, got %d", drift.MissingKeys["key-a"])
+		}
+	})
+
+	t.Run("extra key against expected set", func(t *testing.T) {
+		response := &consulapi.KeyringResponse{
+			Datacenter: "dc1",
+			NumNodes:   3,
+			Keys:       map[string]int{"key-a": 3, "key-rogue": 3},
+		}
+
+		drift := computePoolDrift(response, []string{"key-a"})
+		if len(drift.ExtraKeys) != 1 || drift.ExtraKeys[0] != "key-rogue" {
+			t.Fatalf("expected key-rogue flagged as extra, got %v", drift.ExtraKeys)
+		}
+	})
+
+	t.Run("expected key missing from every node", func(t *testing.T) {
+		response := &consulapi.KeyringResponse{
+			Datacenter: "dc1",
+			NumNodes:   3,
+			Keys:       map[string]int{"key-a": 3},
+		}
+
+		drift := computePoolDrift(response, []string{"key-a", "key-missing"})
+		if !drift.hasDrift() {
+			t.Fatalf("expected drift")
+		}
+		if drift.MissingKeys["key-missing"] != 3 {
+			t.Fatalf("expected all 3 nodes reported missing key-missing, got %d", drift.MissingKeys["key-missing"])
+		}
+	})
+
+	t.Run("primary disagreement", func(t *testing.T) {
+		response := &consulapi.KeyringResponse{
+			Datacenter:  "dc1",
+			NumNodes:    3,
+			Keys:        map[string]int{"key-a": 3},
+			PrimaryKeys: map[string]int{"key-a": 2, "key-b": 1},
+		}
+
+		drift := computePoolDrift(response, nil)
+		if !drift.hasDrift() {
+			t.Fatalf("expected drift from primary disagreement")
+		}
+		if len(drift.PrimaryDisagreement) != 2 {
+			t.Fatalf("expected 2 candidate primaries, got %v", drift.PrimaryDisagreement)
+		}
+	})
+
+	t.Run("unreachable nodes are named", func(t *testing.T) {
+		response := &consulapi.KeyringResponse{
+			Datacenter: "dc1",
+			NumNodes:   3,
+			Keys:       map[string]int{"key-a": 3},
+			Messages:   map[string]string{"node-1": "timed out"},
+		}
+
+		drift := computePoolDrift(response, nil)
+		if len(drift.Unreachable) != 1 || drift.Unreachable[0] != "node-1" {
+			t.Fatalf("expected node-1 reported unreachable, got %v", drift.Unreachable)
+		}
+	})
+}